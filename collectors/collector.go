@@ -0,0 +1,45 @@
+// Package collectors normalizes different feed sources (RSS/Atom, Reddit,
+// YouTube, arbitrary HTML) behind a single Collector interface so the
+// scheduler and persistence layer never need to know which source type a
+// subscription came from.
+package collectors
+
+import (
+	"context"
+	"time"
+)
+
+// Source type identifiers persisted alongside a subscription, used to pick
+// which Collector implementation to build for it.
+const (
+	SourceRSS     = "rss"
+	SourceReddit  = "reddit"
+	SourceYouTube = "youtube"
+	SourceHTML    = "html"
+)
+
+// Item is a single normalized entry from any source.
+type Item struct {
+	GUID        string
+	Title       string
+	Link        string
+	Description string
+	Published   time.Time
+	Author      string
+	MediaURL    string
+}
+
+// Collector fetches the current items for one source (one feed URL, one
+// subreddit, one YouTube channel, one scraped page, ...).
+type Collector interface {
+	Fetch(ctx context.Context) ([]Item, error)
+}
+
+// CacheableCollector is implemented by collectors that support HTTP
+// conditional GET, so a caller can persist their validators across
+// restarts instead of re-downloading unchanged sources on every startup.
+type CacheableCollector interface {
+	Collector
+	Cache() (etag, lastModified string)
+	SetCache(etag, lastModified string)
+}
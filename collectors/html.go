@@ -0,0 +1,89 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// HTMLCollector scrapes items out of a page with no feed of its own, using
+// CSS selectors the user supplies: one selector for the repeating item
+// container, and one each for the title and link within it.
+type HTMLCollector struct {
+	URL           string
+	ItemSelector  string
+	TitleSelector string
+	LinkSelector  string
+	Client        *http.Client
+}
+
+// NewHTMLCollector creates a collector scraping url with the given selectors.
+func NewHTMLCollector(client *http.Client, url, itemSelector, titleSelector, linkSelector string) *HTMLCollector {
+	return &HTMLCollector{
+		URL:           url,
+		ItemSelector:  itemSelector,
+		TitleSelector: titleSelector,
+		LinkSelector:  linkSelector,
+		Client:        client,
+	}
+}
+
+// Fetch retrieves the page and extracts one Item per match of ItemSelector.
+func (c *HTMLCollector) Fetch(ctx context.Context) ([]Item, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error: building request for %q: %w", c.URL, err)
+	}
+	req.Header.Set("User-Agent", "rssagg-discord/1.0")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error: fetching %q: %w", c.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("error: %s returned %s", c.URL, resp.Status)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error: parsing html from %q: %w", c.URL, err)
+	}
+
+	base := resp.Request.URL
+
+	var items []Item
+	doc.Find(c.ItemSelector).Each(func(_ int, sel *goquery.Selection) {
+		title := sel.Find(c.TitleSelector).First().Text()
+		href, _ := sel.Find(c.LinkSelector).First().Attr("href")
+		if title == "" && href == "" {
+			return
+		}
+		link := resolveLink(base, href)
+		items = append(items, Item{
+			GUID:  link,
+			Title: title,
+			Link:  link,
+		})
+	})
+	return items, nil
+}
+
+// resolveLink resolves href against base (the page's own, post-redirect
+// URL), so a page using root- or path-relative hrefs (the common case)
+// still yields a Link Discord can actually open. href is returned unchanged
+// if it isn't a parseable URL reference.
+func resolveLink(base *url.URL, href string) string {
+	if href == "" {
+		return href
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	return base.ResolveReference(ref).String()
+}
@@ -0,0 +1,48 @@
+package collectors
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestResolveLink(t *testing.T) {
+	base, err := url.Parse("https://example.com/blog/index.html")
+	if err != nil {
+		t.Fatalf("parsing base url: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		href string
+		want string
+	}{
+		{
+			name: "already absolute",
+			href: "https://other.example/post-1",
+			want: "https://other.example/post-1",
+		},
+		{
+			name: "root-relative",
+			href: "/blog/post-1",
+			want: "https://example.com/blog/post-1",
+		},
+		{
+			name: "path-relative",
+			href: "post-1.html",
+			want: "https://example.com/blog/post-1.html",
+		},
+		{
+			name: "empty href is left alone",
+			href: "",
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveLink(base, tt.href); got != tt.want {
+				t.Errorf("resolveLink(%q, %q) = %q, want %q", base, tt.href, got, tt.want)
+			}
+		})
+	}
+}
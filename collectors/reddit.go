@@ -0,0 +1,80 @@
+package collectors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RedditCollector polls a subreddit's "new" listing through Reddit's public
+// JSON endpoint. Reddit requires a descriptive User-Agent or it rate-limits
+// generic ones heavily.
+type RedditCollector struct {
+	Subreddit string
+	Client    *http.Client
+}
+
+// NewRedditCollector creates a collector for subreddit (without the leading "r/").
+func NewRedditCollector(client *http.Client, subreddit string) *RedditCollector {
+	return &RedditCollector{Subreddit: subreddit, Client: client}
+}
+
+type redditListing struct {
+	Data struct {
+		Children []struct {
+			Data struct {
+				ID         string  `json:"id"`
+				Title      string  `json:"title"`
+				Permalink  string  `json:"permalink"`
+				Author     string  `json:"author"`
+				CreatedUTC float64 `json:"created_utc"`
+				Thumbnail  string  `json:"thumbnail"`
+			} `json:"data"`
+		} `json:"children"`
+	} `json:"data"`
+}
+
+// Fetch retrieves the subreddit's newest posts.
+func (c *RedditCollector) Fetch(ctx context.Context) ([]Item, error) {
+	url := fmt.Sprintf("https://www.reddit.com/r/%s/new.json", c.Subreddit)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error: building request for %q: %w", url, err)
+	}
+	req.Header.Set("User-Agent", "rssagg-discord/1.0 (RSS aggregator bot)")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error: fetching %q: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("error: reddit returned %s for %q", resp.Status, url)
+	}
+
+	var listing redditListing
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+		return nil, fmt.Errorf("error: decoding reddit listing for %q: %w", url, err)
+	}
+
+	items := make([]Item, 0, len(listing.Data.Children))
+	for _, child := range listing.Data.Children {
+		post := child.Data
+		thumbnail := post.Thumbnail
+		if thumbnail == "self" || thumbnail == "default" || thumbnail == "nsfw" {
+			thumbnail = ""
+		}
+		items = append(items, Item{
+			GUID:      post.ID,
+			Title:     post.Title,
+			Link:      "https://www.reddit.com" + post.Permalink,
+			Published: time.Unix(int64(post.CreatedUTC), 0).UTC(),
+			Author:    post.Author,
+			MediaURL:  thumbnail,
+		})
+	}
+	return items, nil
+}
@@ -0,0 +1,174 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+)
+
+// syPeriodDurations maps a <sy:updatePeriod> value to the span it divides by
+// <sy:updateFrequency>.
+var syPeriodDurations = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+	"yearly":  365 * 24 * time.Hour,
+}
+
+// RSSCollector fetches an RSS/Atom/JSON feed via gofeed. It remembers the
+// ETag/Last-Modified validators from its last successful fetch and sends
+// them as If-None-Match/If-Modified-Since on the next one, so a caller that
+// polls repeatedly doesn't re-download unchanged feeds.
+type RSSCollector struct {
+	URL    string
+	Client *http.Client
+
+	ETag         string
+	LastModified string
+
+	period    time.Duration
+	hasPeriod bool
+}
+
+// NewRSSCollector creates a collector for the feed at url, using client for
+// HTTP requests.
+func NewRSSCollector(client *http.Client, url string) *RSSCollector {
+	return &RSSCollector{URL: url, Client: client}
+}
+
+// Fetch retrieves the feed and returns its items. A 304 Not Modified
+// response yields no items and no error, leaving ETag/LastModified as they
+// were.
+func (c *RSSCollector) Fetch(ctx context.Context) ([]Item, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error: building request for %q: %w", c.URL, err)
+	}
+	req.Header.Set("User-Agent", "rssagg-discord/1.0")
+	if c.ETag != "" {
+		req.Header.Set("If-None-Match", c.ETag)
+	}
+	if c.LastModified != "" {
+		req.Header.Set("If-Modified-Since", c.LastModified)
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error: fetching %q: %w", c.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, gofeed.HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	feed, err := gofeed.NewParser().Parse(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error: parsing feed %q: %w", c.URL, err)
+	}
+
+	c.ETag = resp.Header.Get("ETag")
+	c.LastModified = resp.Header.Get("Last-Modified")
+	c.period, c.hasPeriod = periodFromFeed(feed)
+
+	items := make([]Item, 0, len(feed.Items))
+	for _, item := range feed.Items {
+		items = append(items, itemFromGofeed(item))
+	}
+	return items, nil
+}
+
+// Cache returns the collector's current conditional-GET validators, for a
+// caller that wants to persist them across restarts.
+func (c *RSSCollector) Cache() (etag, lastModified string) {
+	return c.ETag, c.LastModified
+}
+
+// SetCache seeds the collector's conditional-GET validators, e.g. from
+// values persisted on a previous run.
+func (c *RSSCollector) SetCache(etag, lastModified string) {
+	c.ETag = etag
+	c.LastModified = lastModified
+}
+
+// Period returns the polling cadence implied by the feed's own
+// <sy:updatePeriod>/<sy:updateFrequency> extensions, as seen on the last
+// successful Fetch. It reports false if the feed hasn't been fetched yet or
+// carries no such extension (gofeed doesn't expose plain RSS <ttl> on its
+// universal Feed type).
+func (c *RSSCollector) Period() (time.Duration, bool) {
+	return c.period, c.hasPeriod
+}
+
+// periodFromFeed reads the RSS Syndication module's <sy:updatePeriod> and
+// <sy:updateFrequency> extensions, if the feed carries them.
+func periodFromFeed(feed *gofeed.Feed) (time.Duration, bool) {
+	sy, ok := feed.Extensions["sy"]
+	if !ok {
+		return 0, false
+	}
+
+	unit := "daily"
+	if v := sy["updatePeriod"]; len(v) > 0 {
+		unit = strings.TrimSpace(strings.ToLower(v[0].Value))
+	}
+	base, ok := syPeriodDurations[unit]
+	if !ok {
+		return 0, false
+	}
+
+	frequency := 1.0
+	if v := sy["updateFrequency"]; len(v) > 0 {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v[0].Value), 64); err == nil && f > 0 {
+			frequency = f
+		}
+	}
+	return time.Duration(float64(base) / frequency), true
+}
+
+func itemFromGofeed(item *gofeed.Item) Item {
+	out := Item{
+		GUID:        item.GUID,
+		Title:       item.Title,
+		Link:        item.Link,
+		Description: item.Description,
+	}
+	if item.PublishedParsed != nil {
+		out.Published = *item.PublishedParsed
+	}
+	if item.Author != nil {
+		out.Author = item.Author.Name
+	}
+	if item.Image != nil {
+		out.MediaURL = item.Image.URL
+	}
+	for _, enclosure := range item.Enclosures {
+		if out.MediaURL == "" && strings.HasPrefix(enclosure.Type, "image/") {
+			out.MediaURL = enclosure.URL
+		}
+	}
+	if out.MediaURL == "" {
+		out.MediaURL = firstImgSrc(item.Content)
+	}
+	return out
+}
+
+// firstImgSrc returns the src of the first <img> tag in html, if any.
+func firstImgSrc(html string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return ""
+	}
+	src, _ := doc.Find("img").First().Attr("src")
+	return src
+}
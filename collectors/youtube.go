@@ -0,0 +1,34 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// YouTubeCollector polls a channel's uploads via YouTube's public Atom feed
+// endpoint, which needs no API key.
+type YouTubeCollector struct {
+	rss *RSSCollector
+}
+
+// NewYouTubeCollector creates a collector for channelID.
+func NewYouTubeCollector(client *http.Client, channelID string) *YouTubeCollector {
+	url := fmt.Sprintf("https://www.youtube.com/feeds/videos.xml?channel_id=%s", channelID)
+	return &YouTubeCollector{rss: NewRSSCollector(client, url)}
+}
+
+// Fetch retrieves the channel's most recent uploads.
+func (c *YouTubeCollector) Fetch(ctx context.Context) ([]Item, error) {
+	return c.rss.Fetch(ctx)
+}
+
+// Cache returns the underlying feed's conditional-GET validators.
+func (c *YouTubeCollector) Cache() (etag, lastModified string) {
+	return c.rss.Cache()
+}
+
+// SetCache seeds the underlying feed's conditional-GET validators.
+func (c *YouTubeCollector) SetCache(etag, lastModified string) {
+	c.rss.SetCache(etag, lastModified)
+}
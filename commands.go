@@ -0,0 +1,559 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mmcdole/gofeed"
+	"github.com/penguineo/rssagg-discord/collectors"
+	"github.com/rs/zerolog/log"
+)
+
+// rssCommand is the single top-level /rss command. Subscribing is grouped
+// under the "add" subcommand group, one leaf per source type, so Discord can
+// show each source's own options instead of us parsing a free-form string;
+// remove/list/timeout/format/import/export are plain subcommands.
+var rssCommand = &discordgo.ApplicationCommand{
+	Name:        "rss",
+	Description: "Manage feed subscriptions for this channel",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+			Name:        "add",
+			Description: "Subscribe this channel to a source",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "rss",
+					Description: "Subscribe to an RSS/Atom/JSON feed",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "url",
+							Description: "Feed URL",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "reddit",
+					Description: "Subscribe to a subreddit's newest posts",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "subreddit",
+							Description: "Subreddit name, without r/",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "youtube",
+					Description: "Subscribe to a YouTube channel's uploads",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "channel_id",
+							Description: "YouTube channel ID",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "html",
+					Description: "Subscribe to a page with no feed of its own, scraped via CSS selectors",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "url",
+							Description: "Page URL",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "item_selector",
+							Description: "CSS selector matching each repeating item",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "title_selector",
+							Description: "CSS selector for an item's title, relative to item_selector",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "link_selector",
+							Description: "CSS selector for an item's link, relative to item_selector",
+							Required:    true,
+						},
+					},
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "remove",
+			Description: "Unsubscribe this channel from a source",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:         discordgo.ApplicationCommandOptionString,
+					Name:         "source",
+					Description:  "Source to remove",
+					Required:     true,
+					Autocomplete: true,
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "list",
+			Description: "List this channel's subscribed sources",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "timeout",
+			Description: "Set how often sources are polled",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "duration",
+					Description: "Duration, e.g. 10m or 1h",
+					Required:    true,
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "format",
+			Description: "Choose how new posts are rendered in this channel",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "style",
+					Description: "plain or embed",
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "plain", Value: FormatPlain},
+						{Name: "embed", Value: FormatEmbed},
+					},
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "import",
+			Description: "Bulk-subscribe this channel from an OPML file",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionAttachment,
+					Name:        "file",
+					Description: "OPML file to import",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "url",
+					Description: "URL of an OPML file to import",
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "export",
+			Description: "Export this channel's RSS subscriptions as an OPML file",
+		},
+	},
+}
+
+// destructiveSubcommands require ManageChannels so random members can't wipe
+// a server's subscriptions.
+var destructiveSubcommands = map[string]bool{
+	"add":     true,
+	"remove":  true,
+	"timeout": true,
+	"import":  true,
+}
+
+// registerCommands registers the /rss command with Discord. Passing an empty
+// guildID registers it globally.
+func registerCommands(session *discordgo.Session, guildID string) error {
+	_, err := session.ApplicationCommandCreate(session.State.User.ID, guildID, rssCommand)
+	if err != nil {
+		return fmt.Errorf("error: registering /rss command: %w", err)
+	}
+	return nil
+}
+
+// interactionCreate dispatches slash command invocations and autocomplete
+// requests for the /rss command.
+func interactionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		handleRSSCommand(s, i)
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		handleRSSAutocomplete(s, i)
+	}
+}
+
+func handleRSSCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	if data.Name != "rss" || len(data.Options) == 0 {
+		return
+	}
+	sub := data.Options[0]
+
+	if destructiveSubcommands[sub.Name] && !hasManageChannels(i.Interaction) {
+		respond(s, i.Interaction, "You need the Manage Channels permission to do that.")
+		return
+	}
+
+	switch sub.Name {
+	case "add":
+		if len(sub.Options) == 0 {
+			return
+		}
+		leaf := sub.Options[0]
+		switch leaf.Name {
+		case "rss":
+			handleAddRSS(s, i.Interaction, leaf.Options[0].StringValue())
+		case "reddit":
+			handleAddReddit(s, i.Interaction, leaf.Options[0].StringValue())
+		case "youtube":
+			handleAddYouTube(s, i.Interaction, leaf.Options[0].StringValue())
+		case "html":
+			handleAddHTML(s, i.Interaction,
+				leaf.Options[0].StringValue(), leaf.Options[1].StringValue(),
+				leaf.Options[2].StringValue(), leaf.Options[3].StringValue())
+		}
+	case "remove":
+		handleRemove(s, i.Interaction, sub.Options[0].StringValue())
+	case "list":
+		handleList(s, i.Interaction)
+	case "timeout":
+		handleTimeout(s, i.Interaction, sub.Options[0].StringValue())
+	case "format":
+		handleFormat(s, i.Interaction, sub.Options[0].StringValue())
+	case "import":
+		handleImport(s, i.Interaction, sub.Options, data.Resolved)
+	case "export":
+		handleExport(s, i.Interaction)
+	}
+}
+
+func hasManageChannels(i *discordgo.Interaction) bool {
+	if i.Member == nil {
+		return false
+	}
+	return i.Member.Permissions&discordgo.PermissionManageChannels != 0
+}
+
+func handleAddRSS(s *discordgo.Session, i *discordgo.Interaction, url string) {
+	addSubscription(s, i, url, collectors.SourceRSS, nil)
+}
+
+func handleAddReddit(s *discordgo.Session, i *discordgo.Interaction, subreddit string) {
+	addSubscription(s, i, subreddit, collectors.SourceReddit, nil)
+}
+
+func handleAddYouTube(s *discordgo.Session, i *discordgo.Interaction, channelID string) {
+	addSubscription(s, i, channelID, collectors.SourceYouTube, nil)
+}
+
+func handleAddHTML(s *discordgo.Session, i *discordgo.Interaction, url, itemSelector, titleSelector, linkSelector string) {
+	addSubscription(s, i, url, collectors.SourceHTML, map[string]string{
+		"item_selector":  itemSelector,
+		"title_selector": titleSelector,
+		"link_selector":  linkSelector,
+	})
+}
+
+// addSubscription implements the shared add flow for every source type:
+// reject a duplicate, persist it, and schedule its poll.
+func addSubscription(s *discordgo.Session, i *discordgo.Interaction, sourceID, sourceType string, config map[string]string) {
+	exists, err := feedStore.SubscriptionExists(i.ChannelID, sourceID)
+	if err != nil {
+		log.Error().Str("function", "addSubscription").Err(err).Msg("Failed checking subscription existence")
+		respond(s, i, "Something went wrong checking that source.")
+		return
+	}
+	if exists {
+		respond(s, i, "That source is already subscribed here.")
+		return
+	}
+	if err := feedStore.AddSubscription(i.ChannelID, sourceID, sourceType, config); err != nil {
+		log.Error().Str("function", "addSubscription").Err(err).Msg("Failed adding subscription")
+		respond(s, i, "Something went wrong adding that source.")
+		return
+	}
+	if err := scheduler.Register(i.ChannelID, Subscription{SourceID: sourceID, SourceType: sourceType, Config: config}); err != nil {
+		log.Error().Str("function", "addSubscription").Err(err).Msg("Failed scheduling source poll")
+	}
+	respond(s, i, "Source added.")
+}
+
+func handleRemove(s *discordgo.Session, i *discordgo.Interaction, sourceID string) {
+	exists, err := feedStore.SubscriptionExists(i.ChannelID, sourceID)
+	if err != nil {
+		log.Error().Str("function", "handleRemove").Err(err).Msg("Failed checking subscription existence")
+		respond(s, i, "Something went wrong checking that source.")
+		return
+	}
+	if !exists {
+		respond(s, i, "That source isn't subscribed here.")
+		return
+	}
+	if err := feedStore.RemoveSubscription(i.ChannelID, sourceID); err != nil {
+		log.Error().Str("function", "handleRemove").Err(err).Msg("Failed removing subscription")
+		respond(s, i, "Something went wrong removing that source.")
+		return
+	}
+	scheduler.Unregister(i.ChannelID, sourceID)
+	respond(s, i, "Source removed.")
+}
+
+func handleList(s *discordgo.Session, i *discordgo.Interaction) {
+	response, err := feedStore.ListFeed(i.ChannelID)
+	if err != nil {
+		log.Error().Str("function", "handleList").Err(err).Msg("Failed listing subscriptions")
+		respond(s, i, "Something went wrong listing subscriptions.")
+		return
+	}
+	respond(s, i, response)
+}
+
+func handleTimeout(s *discordgo.Session, i *discordgo.Interaction, timeoutStr string) {
+	if err := feedStore.UpdateTimeout(timeoutStr); err != nil {
+		respond(s, i, "Invalid timeout format: "+err.Error())
+		return
+	}
+	if err := scheduler.Reschedule(); err != nil {
+		log.Error().Str("function", "handleTimeout").Err(err).Msg("Failed rescheduling source polls")
+	}
+	respond(s, i, "Timeout updated to "+timeoutStr)
+}
+
+func handleFormat(s *discordgo.Session, i *discordgo.Interaction, format string) {
+	if err := feedStore.SetFormat(i.ChannelID, format); err != nil {
+		respond(s, i, "Invalid format: "+err.Error())
+		return
+	}
+	respond(s, i, "Post format set to "+format+".")
+}
+
+// handleImport bulk-subscribes the invoking channel to every feed found in
+// an OPML file, given either as a message attachment or a URL, deduplicating
+// against subscriptions the channel already has. Downloading the OPML file
+// and registering a poll for every feed it lists can easily run past
+// Discord's ~3s initial-response deadline, so the interaction is
+// acknowledged immediately and the result delivered as a follow-up edit.
+func handleImport(s *discordgo.Session, i *discordgo.Interaction, opts []*discordgo.ApplicationCommandInteractionDataOption, resolved *discordgo.ApplicationCommandInteractionDataResolved) {
+	source := ""
+	for _, opt := range opts {
+		switch opt.Name {
+		case "file":
+			if resolved != nil {
+				if att, ok := resolved.Attachments[opt.StringValue()]; ok {
+					source = att.URL
+				}
+			}
+		case "url":
+			if source == "" {
+				source = opt.StringValue()
+			}
+		}
+	}
+	if source == "" {
+		respond(s, i, "Attach an OPML file or provide a url to import.")
+		return
+	}
+
+	err := s.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		log.Error().Str("function", "handleImport").Err(err).Msg("Failed acknowledging interaction")
+		return
+	}
+
+	go runImport(s, i, source)
+}
+
+// runImport does the download/parse/subscribe work deferred by handleImport
+// and edits the interaction's response with the outcome once it's done.
+func runImport(s *discordgo.Session, i *discordgo.Interaction, source string) {
+	resp, err := http.Get(source)
+	if err != nil {
+		log.Error().Str("function", "runImport").Err(err).Msg("Failed downloading OPML file")
+		editResponse(s, i, "Something went wrong downloading that OPML file.")
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		editResponse(s, i, fmt.Sprintf("Downloading that OPML file returned %s.", resp.Status))
+		return
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Error().Str("function", "runImport").Err(err).Msg("Failed reading OPML file")
+		editResponse(s, i, "Something went wrong reading that OPML file.")
+		return
+	}
+
+	urls, err := parseOPML(body)
+	if err != nil {
+		log.Error().Str("function", "runImport").Err(err).Msg("Failed parsing OPML file")
+		editResponse(s, i, "That doesn't look like a valid OPML file.")
+		return
+	}
+
+	added, skipped := 0, 0
+	for _, url := range urls {
+		exists, err := feedStore.SubscriptionExists(i.ChannelID, url)
+		if err != nil {
+			log.Error().Str("function", "runImport").Err(err).Msg("Failed checking subscription existence")
+			continue
+		}
+		if exists {
+			skipped++
+			continue
+		}
+		if err := feedStore.AddSubscription(i.ChannelID, url, collectors.SourceRSS, nil); err != nil {
+			log.Error().Str("function", "runImport").Err(err).Msg("Failed adding subscription")
+			continue
+		}
+		if err := scheduler.Register(i.ChannelID, Subscription{SourceID: url, SourceType: collectors.SourceRSS}); err != nil {
+			log.Error().Str("function", "runImport").Err(err).Msg("Failed scheduling source poll")
+		}
+		added++
+	}
+	editResponse(s, i, fmt.Sprintf("Imported %d feed(s), skipped %d already subscribed.", added, skipped))
+}
+
+// handleExport replies with an OPML file listing the invoking channel's RSS
+// subscriptions. Each feed's title is resolved with a one-shot fetch the
+// first time it's exported, then cached in the store.
+func handleExport(s *discordgo.Session, i *discordgo.Interaction) {
+	subs, err := feedStore.subscriptionsForChannel(i.ChannelID)
+	if err != nil {
+		log.Error().Str("function", "handleExport").Err(err).Msg("Failed loading subscriptions")
+		respond(s, i, "Something went wrong loading subscriptions.")
+		return
+	}
+
+	var feeds []opmlFeed
+	for _, sub := range subs {
+		if sub.SourceType != collectors.SourceRSS {
+			continue
+		}
+		feeds = append(feeds, opmlFeed{Title: feedTitle(sub.SourceID), XMLURL: sub.SourceID})
+	}
+
+	out, err := buildOPML(feeds)
+	if err != nil {
+		log.Error().Str("function", "handleExport").Err(err).Msg("Failed building OPML file")
+		respond(s, i, "Something went wrong building the OPML file.")
+		return
+	}
+
+	err = s.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: fmt.Sprintf("Exported %d feed(s).", len(feeds)),
+			Files: []*discordgo.File{
+				{Name: "feeds.opml", ContentType: "text/x-opml", Reader: bytes.NewReader(out)},
+			},
+		},
+	})
+	if err != nil {
+		log.Error().Str("function", "handleExport").Err(err).Msg("Failed responding with OPML file")
+	}
+}
+
+// feedTitle returns a display title for feedURL, resolving and caching it
+// with a one-shot gofeed fetch the first time it's needed.
+func feedTitle(feedURL string) string {
+	if title, found, err := feedStore.Title(feedURL); err == nil && found {
+		return title
+	}
+	title := feedURL
+	if feed, err := gofeed.NewParser().ParseURL(feedURL); err == nil && feed.Title != "" {
+		title = feed.Title
+		if err := feedStore.SetTitle(feedURL, title); err != nil {
+			log.Error().Str("function", "feedTitle").Err(err).Msg("Failed caching feed title")
+		}
+	}
+	return title
+}
+
+// handleRSSAutocomplete populates the `remove` subcommand's source option
+// from the invoking channel's current subscriptions.
+func handleRSSAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	if data.Name != "rss" || len(data.Options) == 0 || data.Options[0].Name != "remove" {
+		return
+	}
+
+	subs, err := feedStore.subscriptionsForChannel(i.ChannelID)
+	if err != nil {
+		log.Error().Str("function", "handleRSSAutocomplete").Err(err).Msg("Failed loading subscriptions")
+		subs = nil
+	}
+
+	typed := ""
+	if opts := data.Options[0].Options; len(opts) > 0 {
+		typed = opts[0].StringValue()
+	}
+
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(subs))
+	for _, sub := range subs {
+		if typed != "" && !containsFold(sub.SourceID, typed) {
+			continue
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  fmt.Sprintf("[%s] %s", sub.SourceType, sub.SourceID),
+			Value: sub.SourceID,
+		})
+		if len(choices) == 25 {
+			break
+		}
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+	if err != nil {
+		log.Error().Str("function", "handleRSSAutocomplete").Err(err).Msg("Failed responding with autocomplete choices")
+	}
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func respond(s *discordgo.Session, i *discordgo.Interaction, content string) {
+	err := s.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Content: content},
+	})
+	if err != nil {
+		log.Error().Str("function", "respond").Err(err).Msg("Failed responding to interaction")
+	}
+}
+
+// editResponse edits a previously deferred interaction response, e.g. to
+// deliver the result of work that couldn't finish within Discord's initial
+// ~3s response deadline.
+func editResponse(s *discordgo.Session, i *discordgo.Interaction, content string) {
+	_, err := s.InteractionResponseEdit(i, &discordgo.WebhookEdit{Content: &content})
+	if err != nil {
+		log.Error().Str("function", "editResponse").Err(err).Msg("Failed editing interaction response")
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/bwmarrin/discordgo"
+	"github.com/penguineo/rssagg-discord/collectors"
+)
+
+// maxEmbedDescription is Discord's limit on a MessageEmbed's Description field.
+const maxEmbedDescription = 4096
+
+// buildEmbed renders item as a discordgo.MessageEmbed: title/link, an
+// HTML-stripped and truncated description, author, publish timestamp, and
+// whatever thumbnail the collector resolved for it.
+func buildEmbed(item collectors.Item) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       item.Title,
+		URL:         item.Link,
+		Description: truncate(stripHTML(item.Description), maxEmbedDescription),
+	}
+
+	if item.Author != "" {
+		embed.Author = &discordgo.MessageEmbedAuthor{Name: item.Author}
+	}
+
+	if !item.Published.IsZero() {
+		embed.Timestamp = item.Published.Format("2006-01-02T15:04:05Z07:00")
+	}
+
+	if item.MediaURL != "" {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: item.MediaURL}
+	}
+
+	return embed
+}
+
+// stripHTML renders html down to its plain text content.
+func stripHTML(html string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return html
+	}
+	return strings.TrimSpace(doc.Text())
+}
+
+// truncate shortens s to at most max runes, appending an ellipsis if
+// anything was cut. It slices on rune boundaries rather than bytes, since a
+// byte-index slice can split a multi-byte UTF-8 sequence and hand Discord an
+// invalid Description for any feed with CJK, accented, or emoji content.
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:max-1]) + "…"
+}
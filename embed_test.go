@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		max  int
+		want string
+	}{
+		{
+			name: "shorter than max is untouched",
+			s:    "hello",
+			max:  10,
+			want: "hello",
+		},
+		{
+			name: "exactly max is untouched",
+			s:    "hello",
+			max:  5,
+			want: "hello",
+		},
+		{
+			name: "ascii over max is cut with ellipsis",
+			s:    "hello world",
+			max:  5,
+			want: "hell…",
+		},
+		{
+			name: "multi-byte runes are cut on rune boundaries",
+			s:    "日本語のテスト",
+			max:  4,
+			want: "日本語…",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncate(tt.s, tt.max)
+			if got != tt.want {
+				t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("truncate(%q, %d) = %q is not valid UTF-8", tt.s, tt.max, got)
+			}
+		})
+	}
+}
+
+func TestStripHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "plain text is unchanged",
+			html: "just text",
+			want: "just text",
+		},
+		{
+			name: "tags are stripped",
+			html: "<p>hello <b>world</b></p>",
+			want: "hello world",
+		},
+		{
+			name: "surrounding whitespace is trimmed",
+			html: "  <div>  padded  </div>  ",
+			want: "padded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := stripHTML(tt.html)
+			if strings.TrimSpace(got) != tt.want {
+				t.Errorf("stripHTML(%q) = %q, want %q", tt.html, got, tt.want)
+			}
+		})
+	}
+}
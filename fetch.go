@@ -0,0 +1,112 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/penguineo/rssagg-discord/collectors"
+)
+
+// maxSeenItems bounds how many recent GUIDs/links a watermark remembers for
+// sources with no publish timestamp of their own, so the watermark can't
+// grow unboundedly across restarts.
+const maxSeenItems = 200
+
+// newItemsSince filters items down to those not yet posted, oldest first.
+func newItemsSince(items []collectors.Item, wm watermark) []collectors.Item {
+	var newItems []collectors.Item
+	for _, item := range items {
+		if isNewItem(item, wm) {
+			newItems = append(newItems, item)
+		}
+	}
+	sort.Slice(newItems, func(i, j int) bool {
+		return newItems[i].Published.Before(newItems[j].Published)
+	})
+	return newItems
+}
+
+// isNewItem reports whether item hasn't been posted yet. An item with a
+// parseable timestamp is new if it was published after the watermark.
+// Sources with no such concept of time (e.g. a scraped HTML page, where
+// every item is "published now" on every fetch) are instead checked against
+// wm.Seen, the bounded set of GUIDs/links already posted: comparing only
+// against the single last watermark would mean every other still-present
+// item looks "new" again on the very next tick.
+func isNewItem(item collectors.Item, wm watermark) bool {
+	if wm.GUID == "" && wm.Link == "" && len(wm.Seen) == 0 {
+		return true
+	}
+	if !item.Published.IsZero() && !wm.Published.IsZero() {
+		return item.Published.After(wm.Published)
+	}
+	guid := item.GUID
+	if guid == "" {
+		guid = item.Link
+	}
+	if containsSeen(wm.Seen, guid) || containsSeen(wm.Seen, item.Link) {
+		return false
+	}
+	return guid != wm.GUID && item.Link != wm.Link
+}
+
+func containsSeen(seen []string, id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, s := range seen {
+		if s == id {
+			return true
+		}
+	}
+	return false
+}
+
+// watermarkFor advances previous past postedItems (oldest first, the items
+// actually posted this tick). For timestamped items it's just the latest
+// Published/GUID/Link; for untimestamped items (no concept of "after") it
+// folds their GUIDs/links into the bounded Seen set instead, so a source
+// like HTMLCollector that re-reports its whole page every tick doesn't
+// repost everything that isn't the single most recent item.
+func watermarkFor(previous watermark, postedItems []collectors.Item) watermark {
+	if len(postedItems) == 0 {
+		return previous
+	}
+	latest := postedItems[len(postedItems)-1]
+	wm := watermark{
+		GUID:      latest.GUID,
+		Link:      latest.Link,
+		Published: latest.Published,
+	}
+	if latest.Published.IsZero() {
+		wm.Seen = mergeSeen(previous.Seen, postedItems)
+	}
+	return wm
+}
+
+// mergeSeen unions previous with postedItems' GUIDs/links, oldest first,
+// trimming down to maxSeenItems by dropping the oldest entries.
+func mergeSeen(previous []string, postedItems []collectors.Item) []string {
+	seen := make(map[string]bool, len(previous)+len(postedItems))
+	merged := make([]string, 0, len(previous)+len(postedItems))
+	add := func(id string) {
+		if id == "" || seen[id] {
+			return
+		}
+		seen[id] = true
+		merged = append(merged, id)
+	}
+	for _, id := range previous {
+		add(id)
+	}
+	for _, item := range postedItems {
+		id := item.GUID
+		if id == "" {
+			id = item.Link
+		}
+		add(id)
+	}
+	if len(merged) > maxSeenItems {
+		merged = merged[len(merged)-maxSeenItems:]
+	}
+	return merged
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/penguineo/rssagg-discord/collectors"
+)
+
+func TestIsNewItem(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+
+	tests := []struct {
+		name string
+		item collectors.Item
+		wm   watermark
+		want bool
+	}{
+		{
+			name: "zero watermark is always new",
+			item: collectors.Item{GUID: "a", Published: t1},
+			wm:   watermark{},
+			want: true,
+		},
+		{
+			name: "published after watermark",
+			item: collectors.Item{GUID: "a", Published: t2},
+			wm:   watermark{GUID: "a", Published: t1},
+			want: true,
+		},
+		{
+			name: "published before or equal to watermark",
+			item: collectors.Item{GUID: "b", Published: t1},
+			wm:   watermark{GUID: "a", Published: t1},
+			want: false,
+		},
+		{
+			name: "no timestamps, guid matches watermark",
+			item: collectors.Item{GUID: "a", Link: "http://example.com/a"},
+			wm:   watermark{GUID: "a", Link: "http://example.com/a"},
+			want: false,
+		},
+		{
+			name: "no timestamps, guid differs from watermark",
+			item: collectors.Item{GUID: "b", Link: "http://example.com/b"},
+			wm:   watermark{GUID: "a", Link: "http://example.com/a"},
+			want: true,
+		},
+		{
+			name: "no guid falls back to link",
+			item: collectors.Item{Link: "http://example.com/a"},
+			wm:   watermark{GUID: "a", Link: "http://example.com/a"},
+			want: false,
+		},
+		{
+			name: "no timestamps, guid in seen set",
+			item: collectors.Item{GUID: "b", Link: "http://example.com/b"},
+			wm:   watermark{GUID: "c", Link: "http://example.com/c", Seen: []string{"a", "b"}},
+			want: false,
+		},
+		{
+			name: "no timestamps, guid not in seen set",
+			item: collectors.Item{GUID: "d", Link: "http://example.com/d"},
+			wm:   watermark{GUID: "c", Link: "http://example.com/c", Seen: []string{"a", "b"}},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isNewItem(tt.item, tt.wm); got != tt.want {
+				t.Errorf("isNewItem(%+v, %+v) = %v, want %v", tt.item, tt.wm, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewItemsSince(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	t3 := t1.Add(2 * time.Hour)
+
+	items := []collectors.Item{
+		{GUID: "c", Published: t3},
+		{GUID: "a", Published: t1},
+		{GUID: "b", Published: t2},
+	}
+
+	got := newItemsSince(items, watermark{GUID: "a", Published: t1})
+	if len(got) != 2 {
+		t.Fatalf("newItemsSince returned %d items, want 2", len(got))
+	}
+	if got[0].GUID != "b" || got[1].GUID != "c" {
+		t.Errorf("newItemsSince = %v, want oldest-first [b, c]", got)
+	}
+}
+
+func TestWatermarkFor(t *testing.T) {
+	published := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	item := collectors.Item{GUID: "a", Link: "http://example.com/a", Published: published}
+
+	wm := watermarkFor(watermark{}, []collectors.Item{item})
+	if wm.GUID != item.GUID || wm.Link != item.Link || !wm.Published.Equal(item.Published) {
+		t.Errorf("watermarkFor(%+v) = %+v, want matching fields", item, wm)
+	}
+}
+
+func TestWatermarkForUntimestamped(t *testing.T) {
+	wm := watermarkFor(watermark{}, []collectors.Item{{GUID: "a"}, {GUID: "b"}})
+	if wm.Published.IsZero() == false {
+		t.Fatalf("watermarkFor with untimestamped items set Published, want zero")
+	}
+	if len(wm.Seen) != 2 || wm.Seen[0] != "a" || wm.Seen[1] != "b" {
+		t.Errorf("watermarkFor Seen = %v, want [a b]", wm.Seen)
+	}
+}
+
+// TestScrapedPageDoesNotRepost reproduces the reported bug: an unchanged
+// scraped page (items with no Published timestamp) must not report the same
+// items as "new" again on the very next tick, even though only the single
+// most recent item is the literal watermark match.
+func TestScrapedPageDoesNotRepost(t *testing.T) {
+	page := []collectors.Item{
+		{GUID: "post-3", Link: "http://example.com/post-3"},
+		{GUID: "post-2", Link: "http://example.com/post-2"},
+		{GUID: "post-1", Link: "http://example.com/post-1"},
+	}
+
+	firstTick := newItemsSince(page, watermark{})
+	if len(firstTick) != 3 {
+		t.Fatalf("first tick returned %d items, want 3", len(firstTick))
+	}
+	wm := watermarkFor(watermark{}, firstTick)
+
+	secondTick := newItemsSince(page, wm)
+	if len(secondTick) != 0 {
+		t.Errorf("second tick over an unchanged page returned %d items, want 0 (got %v)", len(secondTick), secondTick)
+	}
+}
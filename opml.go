@@ -0,0 +1,80 @@
+package main
+
+import "encoding/xml"
+
+// opmlDocument is the subset of OPML 2.0 this package reads and writes:
+// a flat or nested <body> of <outline> elements, each either a feed
+// (carrying xmlUrl) or a category folder containing more outlines.
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    opmlHead `xml:"head"`
+	Body    opmlBody `xml:"body"`
+}
+
+type opmlHead struct {
+	Title string `xml:"title"`
+}
+
+type opmlBody struct {
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr"`
+	Type     string        `xml:"type,attr"`
+	XMLURL   string        `xml:"xmlUrl,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// parseOPML extracts every feed URL from an OPML document, recursing into
+// category folders (outlines with no xmlUrl of their own but nested
+// outlines).
+func parseOPML(data []byte) ([]string, error) {
+	var doc opmlDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return feedURLsFromOutlines(doc.Body.Outlines), nil
+}
+
+func feedURLsFromOutlines(outlines []opmlOutline) []string {
+	var urls []string
+	for _, o := range outlines {
+		if o.XMLURL != "" {
+			urls = append(urls, o.XMLURL)
+		}
+		if len(o.Outlines) > 0 {
+			urls = append(urls, feedURLsFromOutlines(o.Outlines)...)
+		}
+	}
+	return urls
+}
+
+// opmlFeed is one feed to render as a flat <outline> when exporting.
+type opmlFeed struct {
+	Title  string
+	XMLURL string
+}
+
+// buildOPML renders feeds as an OPML 2.0 document.
+func buildOPML(feeds []opmlFeed) ([]byte, error) {
+	doc := opmlDocument{
+		Version: "2.0",
+		Head:    opmlHead{Title: "rssagg-discord feed export"},
+	}
+	for _, feed := range feeds {
+		doc.Body.Outlines = append(doc.Body.Outlines, opmlOutline{
+			Text:   feed.Title,
+			Title:  feed.Title,
+			Type:   "rss",
+			XMLURL: feed.XMLURL,
+		})
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
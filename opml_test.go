@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOPML(t *testing.T) {
+	tests := []struct {
+		name string
+		opml string
+		want []string
+	}{
+		{
+			name: "flat list of feeds",
+			opml: `<opml version="2.0"><body>
+				<outline text="A" xmlUrl="http://a.example/feed"/>
+				<outline text="B" xmlUrl="http://b.example/feed"/>
+			</body></opml>`,
+			want: []string{"http://a.example/feed", "http://b.example/feed"},
+		},
+		{
+			name: "nested category folders",
+			opml: `<opml version="2.0"><body>
+				<outline text="Tech">
+					<outline text="A" xmlUrl="http://a.example/feed"/>
+				</outline>
+				<outline text="B" xmlUrl="http://b.example/feed"/>
+			</body></opml>`,
+			want: []string{"http://a.example/feed", "http://b.example/feed"},
+		},
+		{
+			name: "no feeds",
+			opml: `<opml version="2.0"><body></body></opml>`,
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOPML([]byte(tt.opml))
+			if err != nil {
+				t.Fatalf("parseOPML() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseOPML() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOPMLInvalid(t *testing.T) {
+	if _, err := parseOPML([]byte("not xml")); err == nil {
+		t.Error("parseOPML() with invalid XML returned nil error, want error")
+	}
+}
+
+func TestBuildOPMLRoundTrip(t *testing.T) {
+	feeds := []opmlFeed{
+		{Title: "A", XMLURL: "http://a.example/feed"},
+		{Title: "B", XMLURL: "http://b.example/feed"},
+	}
+
+	out, err := buildOPML(feeds)
+	if err != nil {
+		t.Fatalf("buildOPML() error = %v", err)
+	}
+
+	urls, err := parseOPML(out)
+	if err != nil {
+		t.Fatalf("parseOPML(buildOPML()) error = %v", err)
+	}
+
+	want := []string{"http://a.example/feed", "http://b.example/feed"}
+	if !reflect.DeepEqual(urls, want) {
+		t.Errorf("round-tripped urls = %v, want %v", urls, want)
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/penguineo/rssagg-discord/collectors"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// Scheduler polls every (channelID, sourceID) subscription on its own cron
+// entry, instead of re-fetching every source on one shared tick. An RSS
+// subscription's cadence comes from its own <sy:updatePeriod>/
+// <sy:updateFrequency> when present, otherwise falls back to the store's
+// default timeout; other source types always use the default timeout, since
+// they have no equivalent self-reported cadence. Entries are registered with
+// a small random jitter so a bot with many subscriptions doesn't hit every
+// upstream at once.
+type Scheduler struct {
+	shards *ShardManager
+	cron   *cron.Cron
+	client *http.Client
+
+	mu       sync.Mutex
+	entries  map[string]cron.EntryID
+	resolved map[string]bool
+	backoffs map[string]*feedBackoff
+}
+
+// feedBackoff tracks exponential backoff after repeated fetch errors for a
+// source, shared across every channel subscribed to it.
+type feedBackoff struct {
+	backoff     *backoff.Backoff
+	nextAllowed time.Time
+}
+
+// NewScheduler creates a Scheduler that posts new items through shards.
+func NewScheduler(shards *ShardManager) *Scheduler {
+	return &Scheduler{
+		shards:   shards,
+		cron:     cron.New(),
+		client:   &http.Client{Timeout: 15 * time.Second},
+		entries:  make(map[string]cron.EntryID),
+		resolved: make(map[string]bool),
+		backoffs: make(map[string]*feedBackoff),
+	}
+}
+
+// Start begins running registered cron entries in the background.
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+// Stop waits for running jobs to finish and stops the cron scheduler.
+func (s *Scheduler) Stop() context.Context {
+	return s.cron.Stop()
+}
+
+// RegisterAll schedules a cron entry for every persisted subscription. Call
+// once at startup.
+func (s *Scheduler) RegisterAll() error {
+	subscriptions, err := feedStore.Subscriptions()
+	if err != nil {
+		return err
+	}
+	for channelID, subs := range subscriptions {
+		for _, sub := range subs {
+			if err := s.Register(channelID, sub); err != nil {
+				log.Error().
+					Err(err).
+					Str("function", "Scheduler.RegisterAll").
+					Str("channel_id", channelID).
+					Str("source_id", sub.SourceID).
+					Str("source_type", sub.SourceType).
+					Msg("Failed registering source poll")
+			}
+		}
+	}
+	return nil
+}
+
+// Register adds a cron entry polling (channelID, sub) at the store's default
+// cadence. It is a no-op if that pair is already registered. For RSS
+// subscriptions, the entry is later rescheduled to the feed's own
+// <sy:updatePeriod>/<sy:updateFrequency> cadence once the first tick fetches
+// it successfully; Register itself never makes a network call, so it's safe
+// to call from a request path with a tight response deadline (e.g. a Discord
+// interaction handler importing many feeds at once).
+func (s *Scheduler) Register(channelID string, sub Subscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := entryKey(channelID, sub.SourceID)
+	if _, ok := s.entries[key]; ok {
+		return nil
+	}
+
+	def, err := feedStore.Timeout()
+	if err != nil {
+		return err
+	}
+	s.entries[key] = s.scheduleLocked(key, channelID, sub, def)
+	return nil
+}
+
+// Unregister removes the cron entry for (channelID, sourceID), if any.
+func (s *Scheduler) Unregister(channelID, sourceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := entryKey(channelID, sourceID)
+	if entryID, ok := s.entries[key]; ok {
+		s.cron.Remove(entryID)
+		delete(s.entries, key)
+	}
+	delete(s.resolved, key)
+}
+
+// Reschedule re-registers every subscription's cron entry, picking up any
+// change to the store's default timeout for sources with no detectable
+// cadence of their own.
+func (s *Scheduler) Reschedule() error {
+	s.mu.Lock()
+	for key, entryID := range s.entries {
+		s.cron.Remove(entryID)
+		delete(s.entries, key)
+	}
+	s.resolved = make(map[string]bool)
+	s.mu.Unlock()
+	return s.RegisterAll()
+}
+
+// scheduleLocked creates the cron entry for (channelID, sub) at period. The
+// caller must hold s.mu.
+func (s *Scheduler) scheduleLocked(key string, channelID string, sub Subscription, period time.Duration) cron.EntryID {
+	schedule := newJitteredSchedule(period)
+	return s.cron.Schedule(schedule, cron.FuncJob(func() {
+		s.tick(channelID, sub)
+	}))
+}
+
+// resolveCadence swaps an RSS subscription's cron entry to its own
+// self-reported cadence, once, the first time rss has been successfully
+// fetched. It's a no-op for every tick after the first for that key.
+func (s *Scheduler) resolveCadence(key string, channelID string, sub Subscription, rss *collectors.RSSCollector) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.resolved[key] {
+		return
+	}
+	s.resolved[key] = true
+
+	period, ok := rss.Period()
+	if !ok {
+		return
+	}
+	entryID, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	s.cron.Remove(entryID)
+	s.entries[key] = s.scheduleLocked(key, channelID, sub, period)
+}
+
+func entryKey(channelID, sourceID string) string {
+	return channelID + "\x00" + sourceID
+}
+
+// collectorFor builds the Collector implementation matching sub's source type.
+func collectorFor(client *http.Client, sub Subscription) (collectors.Collector, error) {
+	switch sub.SourceType {
+	case collectors.SourceRSS:
+		return collectors.NewRSSCollector(client, sub.SourceID), nil
+	case collectors.SourceReddit:
+		return collectors.NewRedditCollector(client, sub.SourceID), nil
+	case collectors.SourceYouTube:
+		return collectors.NewYouTubeCollector(client, sub.SourceID), nil
+	case collectors.SourceHTML:
+		return collectors.NewHTMLCollector(client, sub.SourceID,
+			sub.Config["item_selector"], sub.Config["title_selector"], sub.Config["link_selector"]), nil
+	default:
+		return nil, fmt.Errorf("error: unknown source type %q", sub.SourceType)
+	}
+}
+
+// tick fetches one (channelID, sub) pair, posts any new items, and advances
+// the stored watermark. Repeated errors push the source into exponential
+// backoff so a broken upstream isn't retried at full rate.
+func (s *Scheduler) tick(channelID string, sub Subscription) {
+	if skip, wait := s.backoffActive(sub.SourceID); skip {
+		log.Debug().
+			Str("function", "Scheduler.tick").
+			Str("source_id", sub.SourceID).
+			Dur("retry_in", wait).
+			Msg("Skipping tick, source is backing off")
+		return
+	}
+
+	collector, err := collectorFor(s.client, sub)
+	if err != nil {
+		log.Error().Err(err).Str("function", "Scheduler.tick").Str("source_id", sub.SourceID).Msg("Failed building collector")
+		return
+	}
+	if cacheable, ok := collector.(collectors.CacheableCollector); ok {
+		if entry, err := feedStore.HTTPCache(sub.SourceID); err == nil {
+			cacheable.SetCache(entry.ETag, entry.LastModified)
+		}
+	}
+
+	items, err := collector.Fetch(context.Background())
+	if err != nil {
+		delay := s.recordFailure(sub.SourceID)
+		log.Warn().
+			Err(err).
+			Str("function", "Scheduler.tick").
+			Str("channel_id", channelID).
+			Str("source_id", sub.SourceID).
+			Dur("retry_in", delay).
+			Msg("Failed fetching source, backing off")
+		return
+	}
+	s.recordSuccess(sub.SourceID)
+
+	if rss, ok := collector.(*collectors.RSSCollector); ok {
+		s.resolveCadence(entryKey(channelID, sub.SourceID), channelID, sub, rss)
+	}
+
+	if cacheable, ok := collector.(collectors.CacheableCollector); ok {
+		etag, lastModified := cacheable.Cache()
+		if err := feedStore.SetHTTPCache(sub.SourceID, httpCacheEntry{ETag: etag, LastModified: lastModified}); err != nil {
+			log.Error().Err(err).Str("function", "Scheduler.tick").Str("source_id", sub.SourceID).Msg("Failed persisting http cache")
+		}
+	}
+
+	wm, err := feedStore.Watermark(channelID, sub.SourceID)
+	if err != nil {
+		log.Error().Err(err).Str("function", "Scheduler.tick").Str("channel_id", channelID).Str("source_id", sub.SourceID).Msg("Failed reading watermark")
+		return
+	}
+
+	newItems := newItemsSince(items, wm)
+	posted := 0
+	for _, item := range newItems {
+		if err := postItem(s.shards, channelID, item); err != nil {
+			// Stop here rather than pressing on: advancing the watermark
+			// past this item would drop it permanently, since it'll never
+			// appear as "new" again on a later tick.
+			break
+		}
+		posted++
+	}
+	if posted == 0 {
+		return
+	}
+	if err := feedStore.SetWatermark(channelID, sub.SourceID, watermarkFor(wm, newItems[:posted])); err != nil {
+		log.Error().
+			Err(err).
+			Str("function", "Scheduler.tick").
+			Str("channel_id", channelID).
+			Str("source_id", sub.SourceID).
+			Msg("Failed advancing watermark")
+	}
+}
+
+func (s *Scheduler) backoffActive(sourceID string) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fb, ok := s.backoffs[sourceID]
+	if !ok || fb.nextAllowed.IsZero() {
+		return false, 0
+	}
+	if wait := time.Until(fb.nextAllowed); wait > 0 {
+		return true, wait
+	}
+	return false, 0
+}
+
+func (s *Scheduler) recordFailure(sourceID string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fb, ok := s.backoffs[sourceID]
+	if !ok {
+		fb = &feedBackoff{backoff: &backoff.Backoff{Min: 1 * time.Minute, Max: 6 * time.Hour, Jitter: true}}
+		s.backoffs[sourceID] = fb
+	}
+	delay := fb.backoff.Duration()
+	fb.nextAllowed = time.Now().Add(delay)
+	return delay
+}
+
+func (s *Scheduler) recordSuccess(sourceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fb, ok := s.backoffs[sourceID]; ok {
+		fb.backoff.Reset()
+		fb.nextAllowed = time.Time{}
+	}
+}
+
+// jitteredSchedule runs every interval, except its very first run is
+// offset by a random delay up to interval/4 so many entries registered at
+// once don't all fire together.
+type jitteredSchedule struct {
+	interval time.Duration
+	jitter   time.Duration
+	fired    bool
+}
+
+func newJitteredSchedule(interval time.Duration) *jitteredSchedule {
+	spread := int64(interval / 4)
+	var jitter time.Duration
+	if spread > 0 {
+		jitter = time.Duration(rand.Int63n(spread))
+	}
+	return &jitteredSchedule{interval: interval, jitter: jitter}
+}
+
+func (j *jitteredSchedule) Next(t time.Time) time.Time {
+	if !j.fired {
+		j.fired = true
+		return t.Add(j.jitter)
+	}
+	return t.Add(j.interval)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// identifyDelay is how long ShardManager waits between opening consecutive
+// shards, to stay under Discord's one-identify-per-5-seconds gateway limit.
+const identifyDelay = 5 * time.Second
+
+// ShardManager owns one *discordgo.Session per gateway shard, so a bot in
+// enough guilds to need more than one connection still looks like a single
+// bot to the rest of the package: callers resolve the session for a given
+// channel/guild through it instead of holding a session directly.
+type ShardManager struct {
+	sessions []*discordgo.Session
+}
+
+// NewShardManager builds a ShardManager with shardCount sessions for token,
+// each with its ShardID/ShardCount set and the interaction handler attached.
+// If shardCount is 0, it's discovered via Discord's recommended shard count
+// from GET /gateway/bot.
+func NewShardManager(token string, shardCount int) (*ShardManager, error) {
+	if shardCount <= 0 {
+		n, err := recommendedShardCount(token)
+		if err != nil {
+			return nil, err
+		}
+		shardCount = n
+	}
+
+	sessions := make([]*discordgo.Session, shardCount)
+	for shardID := 0; shardID < shardCount; shardID++ {
+		session, err := discordgo.New("Bot " + token)
+		if err != nil {
+			return nil, fmt.Errorf("error: creating discord session for shard %d: %w", shardID, err)
+		}
+		session.ShardID = shardID
+		session.ShardCount = shardCount
+		session.Identify.Intents = discordgo.IntentsGuilds
+		session.AddHandler(interactionCreate)
+		sessions[shardID] = session
+	}
+	return &ShardManager{sessions: sessions}, nil
+}
+
+// recommendedShardCount asks Discord how many shards a bot with token should
+// run, via GET /gateway/bot.
+func recommendedShardCount(token string) (int, error) {
+	session, err := discordgo.New("Bot " + token)
+	if err != nil {
+		return 0, fmt.Errorf("error: creating discord session to query shard count: %w", err)
+	}
+	info, err := session.GatewayBot()
+	if err != nil {
+		return 0, fmt.Errorf("error: fetching recommended shard count: %w", err)
+	}
+	if info.Shards < 1 {
+		return 1, nil
+	}
+	return info.Shards, nil
+}
+
+// Open opens every shard's gateway connection, staggered by identifyDelay so
+// shards don't violate Discord's identify rate limit.
+func (m *ShardManager) Open() error {
+	for shardID, session := range m.sessions {
+		if err := session.Open(); err != nil {
+			return fmt.Errorf("error: opening shard %d: %w", shardID, err)
+		}
+		if shardID < len(m.sessions)-1 {
+			time.Sleep(identifyDelay)
+		}
+	}
+	return nil
+}
+
+// Close closes every shard's gateway connection, continuing past individual
+// failures so one stuck shard can't block the others from shutting down. It
+// returns the first error encountered, if any.
+func (m *ShardManager) Close() error {
+	var firstErr error
+	for shardID, session := range m.sessions {
+		if err := session.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error: closing shard %d: %w", shardID, err)
+		}
+	}
+	return firstErr
+}
+
+// ShardCount returns the number of shards the manager is running.
+func (m *ShardManager) ShardCount() int {
+	return len(m.sessions)
+}
+
+// Session returns the shard at shardID, for registering commands or other
+// shard-agnostic REST calls.
+func (m *ShardManager) Session(shardID int) *discordgo.Session {
+	return m.sessions[shardID]
+}
+
+// SessionForGuild returns the session for the shard responsible for guildID,
+// using Discord's (guild_id >> 22) % num_shards formula.
+func (m *ShardManager) SessionForGuild(guildID string) *discordgo.Session {
+	if len(m.sessions) == 1 {
+		return m.sessions[0]
+	}
+	id, err := strconv.ParseUint(guildID, 10, 64)
+	if err != nil {
+		return m.sessions[0]
+	}
+	shardID := (id >> 22) % uint64(len(m.sessions))
+	return m.sessions[shardID]
+}
+
+// SessionForChannel resolves channelID's guild and returns the session for
+// the shard serving it. The lookup itself is a REST call and can be made
+// through any shard, since only the gateway connection is shard-specific.
+func (m *ShardManager) SessionForChannel(channelID string) (*discordgo.Session, error) {
+	if len(m.sessions) == 1 {
+		return m.sessions[0], nil
+	}
+	channel, err := m.sessions[0].Channel(channelID)
+	if err != nil {
+		return nil, fmt.Errorf("error: resolving channel %q: %w", channelID, err)
+	}
+	return m.SessionForGuild(channel.GuildID), nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// newTestShardManager builds a ShardManager with n bare sessions, enough to
+// exercise the shard-selection formulas without opening a gateway connection.
+func newTestShardManager(n int) *ShardManager {
+	sessions := make([]*discordgo.Session, n)
+	for i := range sessions {
+		sessions[i] = &discordgo.Session{ShardID: i, ShardCount: n}
+	}
+	return &ShardManager{sessions: sessions}
+}
+
+func TestSessionForGuild(t *testing.T) {
+	tests := []struct {
+		name        string
+		shardCount  int
+		guildID     string
+		wantShardID int
+	}{
+		{
+			name:        "single shard always wins",
+			shardCount:  1,
+			guildID:     "123456789012345678",
+			wantShardID: 0,
+		},
+		{
+			name:        "uses (guild_id >> 22) % num_shards",
+			shardCount:  4,
+			guildID:     "198442865477181440",
+			wantShardID: int((198442865477181440 >> 22) % 4),
+		},
+		{
+			name:        "unparseable guild id falls back to shard 0",
+			shardCount:  4,
+			guildID:     "not-a-snowflake",
+			wantShardID: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestShardManager(tt.shardCount)
+			got := m.SessionForGuild(tt.guildID)
+			if got.ShardID != tt.wantShardID {
+				t.Errorf("SessionForGuild(%q) shard = %d, want %d", tt.guildID, got.ShardID, tt.wantShardID)
+			}
+		})
+	}
+}
+
+func TestShardCount(t *testing.T) {
+	m := newTestShardManager(3)
+	if got := m.ShardCount(); got != 3 {
+		t.Errorf("ShardCount() = %d, want 3", got)
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/penguineo/rssagg-discord/collectors"
+	"go.etcd.io/bbolt"
+)
+
+var (
+	bucketSubscriptions = []byte("subscriptions")
+	bucketConfig        = []byte("config")
+	bucketFormat        = []byte("format")
+	bucketHTTPCache     = []byte("httpcache")
+	bucketTitles        = []byte("titles")
+
+	configKeyTimeout = []byte("timeout")
+)
+
+// FormatPlain and FormatEmbed are the valid values for a channel's post format.
+const (
+	FormatPlain = "plain"
+	FormatEmbed = "embed"
+)
+
+// watermark tracks the most recent item posted for a given (channelID,
+// sourceID) pair so the scheduler never re-posts an item it has already
+// sent. Seen additionally bounds a set of recently posted GUIDs/links, used
+// instead of GUID/Link/Published for sources with no publish timestamp of
+// their own (e.g. HTMLCollector), since those can't be ordered by "after".
+type watermark struct {
+	GUID      string    `json:"guid"`
+	Link      string    `json:"link"`
+	Published time.Time `json:"published"`
+	Seen      []string  `json:"seen,omitempty"`
+}
+
+// subscriptionState is what's stored per (channelID, sourceID) subscription:
+// which Collector implementation to build (SourceType), any config it needs
+// (e.g. an HTMLCollector's selectors), and the dedup watermark.
+type subscriptionState struct {
+	SourceType string            `json:"source_type"`
+	Config     map[string]string `json:"config,omitempty"`
+	Watermark  watermark         `json:"watermark"`
+}
+
+// Subscription describes one (channelID, sourceID) pairing as returned by
+// FeedStore.Subscriptions.
+type Subscription struct {
+	SourceID   string
+	SourceType string
+	Config     map[string]string
+}
+
+// FeedStore persists channel subscriptions and per-feed watermarks in a bbolt
+// database so that subscriptions and dedup state survive a bot restart.
+type FeedStore struct {
+	db             *bbolt.DB
+	defaultTimeout time.Duration
+}
+
+// NewFeedStore opens (creating if necessary) the bbolt database at path and
+// ensures the buckets used by FeedStore exist.
+func NewFeedStore(path string, defaultTimeout time.Duration) (*FeedStore, error) {
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error: opening feed store at %q: %w", path, err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(bucketSubscriptions); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketConfig); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketFormat); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketHTTPCache); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketTitles); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("error: initializing feed store buckets: %w", err)
+	}
+	return &FeedStore{db: db, defaultTimeout: defaultTimeout}, nil
+}
+
+// Close releases the underlying bbolt database file.
+func (fs *FeedStore) Close() error {
+	return fs.db.Close()
+}
+
+// AddSubscription subscribes channelID to sourceID (a feed URL, subreddit
+// name, YouTube channel ID, or scraped page URL, depending on sourceType).
+// It is a no-op if the subscription already exists.
+func (fs *FeedStore) AddSubscription(channelID, sourceID, sourceType string, config map[string]string) error {
+	return fs.db.Update(func(tx *bbolt.Tx) error {
+		channels, err := tx.Bucket(bucketSubscriptions).CreateBucketIfNotExists([]byte(channelID))
+		if err != nil {
+			return err
+		}
+		if channels.Get([]byte(sourceID)) != nil {
+			return nil
+		}
+		return channels.Put([]byte(sourceID), mustMarshal(subscriptionState{SourceType: sourceType, Config: config}))
+	})
+}
+
+// RemoveSubscription unsubscribes channelID from sourceID, dropping its watermark.
+func (fs *FeedStore) RemoveSubscription(channelID, sourceID string) error {
+	return fs.db.Update(func(tx *bbolt.Tx) error {
+		channels := tx.Bucket(bucketSubscriptions).Bucket([]byte(channelID))
+		if channels == nil {
+			return nil
+		}
+		return channels.Delete([]byte(sourceID))
+	})
+}
+
+// ListFeed renders the sources subscribed to by channelID as a user-facing string.
+func (fs *FeedStore) ListFeed(channelID string) (string, error) {
+	subs, err := fs.subscriptionsForChannel(channelID)
+	if err != nil {
+		return "", err
+	}
+	if len(subs) == 0 {
+		return "No feeds subscribed.", nil
+	}
+	out := "Subscribed feeds:\n"
+	for i, sub := range subs {
+		if i > 0 {
+			out += "\n"
+		}
+		out += fmt.Sprintf("[%s] %s", sub.SourceType, sub.SourceID)
+	}
+	return out, nil
+}
+
+// SubscriptionExists reports whether channelID is already subscribed to sourceID.
+func (fs *FeedStore) SubscriptionExists(channelID, sourceID string) (bool, error) {
+	exists := false
+	err := fs.db.View(func(tx *bbolt.Tx) error {
+		channels := tx.Bucket(bucketSubscriptions).Bucket([]byte(channelID))
+		if channels == nil {
+			return nil
+		}
+		exists = channels.Get([]byte(sourceID)) != nil
+		return nil
+	})
+	return exists, err
+}
+
+// Subscriptions returns every channelID's subscriptions, keyed by channel.
+func (fs *FeedStore) Subscriptions() (map[string][]Subscription, error) {
+	subs := make(map[string][]Subscription)
+	err := fs.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketSubscriptions).ForEach(func(channelID, _ []byte) error {
+			channels := tx.Bucket(bucketSubscriptions).Bucket(channelID)
+			if channels == nil {
+				return nil
+			}
+			return channels.ForEach(func(sourceID, raw []byte) error {
+				state, err := decodeSubscriptionState(raw)
+				if err != nil {
+					return err
+				}
+				subs[string(channelID)] = append(subs[string(channelID)], Subscription{
+					SourceID:   string(sourceID),
+					SourceType: state.SourceType,
+					Config:     state.Config,
+				})
+				return nil
+			})
+		})
+	})
+	return subs, err
+}
+
+func (fs *FeedStore) subscriptionsForChannel(channelID string) ([]Subscription, error) {
+	var subs []Subscription
+	err := fs.db.View(func(tx *bbolt.Tx) error {
+		channels := tx.Bucket(bucketSubscriptions).Bucket([]byte(channelID))
+		if channels == nil {
+			return nil
+		}
+		return channels.ForEach(func(sourceID, raw []byte) error {
+			state, err := decodeSubscriptionState(raw)
+			if err != nil {
+				return err
+			}
+			subs = append(subs, Subscription{
+				SourceID:   string(sourceID),
+				SourceType: state.SourceType,
+				Config:     state.Config,
+			})
+			return nil
+		})
+	})
+	return subs, err
+}
+
+// Watermark returns the last-posted item state for (channelID, sourceID). A
+// zero-value watermark is returned (without error) if nothing has been
+// posted yet for that pair.
+func (fs *FeedStore) Watermark(channelID, sourceID string) (watermark, error) {
+	state, err := fs.subscriptionState(channelID, sourceID)
+	return state.Watermark, err
+}
+
+// SetWatermark advances the stored watermark for (channelID, sourceID).
+func (fs *FeedStore) SetWatermark(channelID, sourceID string, wm watermark) error {
+	return fs.db.Update(func(tx *bbolt.Tx) error {
+		channels, err := tx.Bucket(bucketSubscriptions).CreateBucketIfNotExists([]byte(channelID))
+		if err != nil {
+			return err
+		}
+		var state subscriptionState
+		if raw := channels.Get([]byte(sourceID)); raw != nil {
+			var err error
+			state, err = decodeSubscriptionState(raw)
+			if err != nil {
+				return err
+			}
+		}
+		state.Watermark = wm
+		return channels.Put([]byte(sourceID), mustMarshal(state))
+	})
+}
+
+func (fs *FeedStore) subscriptionState(channelID, sourceID string) (subscriptionState, error) {
+	var state subscriptionState
+	err := fs.db.View(func(tx *bbolt.Tx) error {
+		channels := tx.Bucket(bucketSubscriptions).Bucket([]byte(channelID))
+		if channels == nil {
+			return nil
+		}
+		raw := channels.Get([]byte(sourceID))
+		if raw == nil {
+			return nil
+		}
+		var err error
+		state, err = decodeSubscriptionState(raw)
+		return err
+	})
+	return state, err
+}
+
+// UpdateTimeout parses and persists the global poll interval.
+func (fs *FeedStore) UpdateTimeout(timeoutStr string) error {
+	d, err := time.ParseDuration(timeoutStr)
+	if err != nil {
+		return err
+	}
+	err = fs.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketConfig).Put(configKeyTimeout, []byte(d.String()))
+	})
+	if err != nil {
+		return err
+	}
+	fs.defaultTimeout = d
+	return nil
+}
+
+// Timeout returns the current poll interval, falling back to the value the
+// store was created with if none has been persisted yet.
+func (fs *FeedStore) Timeout() (time.Duration, error) {
+	raw := ""
+	err := fs.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(bucketConfig).Get(configKeyTimeout)
+		if v != nil {
+			raw = string(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if raw == "" {
+		return fs.defaultTimeout, nil
+	}
+	return time.ParseDuration(raw)
+}
+
+// Format returns the post format ("plain" or "embed") for channelID,
+// defaulting to FormatEmbed if the channel hasn't set one.
+func (fs *FeedStore) Format(channelID string) (string, error) {
+	format := FormatEmbed
+	err := fs.db.View(func(tx *bbolt.Tx) error {
+		if v := tx.Bucket(bucketFormat).Get([]byte(channelID)); v != nil {
+			format = string(v)
+		}
+		return nil
+	})
+	return format, err
+}
+
+// SetFormat persists channelID's post format, which must be FormatPlain or
+// FormatEmbed.
+func (fs *FeedStore) SetFormat(channelID, format string) error {
+	if format != FormatPlain && format != FormatEmbed {
+		return fmt.Errorf("error: unknown format %q", format)
+	}
+	return fs.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketFormat).Put([]byte(channelID), []byte(format))
+	})
+}
+
+// httpCacheEntry is the conditional-GET validator for a feed URL.
+type httpCacheEntry struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// HTTPCache returns the stored ETag/Last-Modified validators for feedURL, if any.
+func (fs *FeedStore) HTTPCache(feedURL string) (httpCacheEntry, error) {
+	var entry httpCacheEntry
+	err := fs.db.View(func(tx *bbolt.Tx) error {
+		raw := tx.Bucket(bucketHTTPCache).Get([]byte(feedURL))
+		if raw == nil {
+			return nil
+		}
+		return json.Unmarshal(raw, &entry)
+	})
+	return entry, err
+}
+
+// SetHTTPCache persists the ETag/Last-Modified validators for feedURL.
+func (fs *FeedStore) SetHTTPCache(feedURL string, entry httpCacheEntry) error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return fs.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketHTTPCache).Put([]byte(feedURL), raw)
+	})
+}
+
+// Title returns the cached display title for sourceID, if one has been
+// resolved before. The bool reports whether a title was found.
+func (fs *FeedStore) Title(sourceID string) (string, bool, error) {
+	var title string
+	found := false
+	err := fs.db.View(func(tx *bbolt.Tx) error {
+		if v := tx.Bucket(bucketTitles).Get([]byte(sourceID)); v != nil {
+			title = string(v)
+			found = true
+		}
+		return nil
+	})
+	return title, found, err
+}
+
+// SetTitle caches the display title resolved for sourceID, e.g. from a
+// one-shot feed fetch during OPML export, so later exports don't re-fetch it.
+func (fs *FeedStore) SetTitle(sourceID, title string) error {
+	return fs.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketTitles).Put([]byte(sourceID), []byte(title))
+	})
+}
+
+// decodeSubscriptionState unmarshals a persisted subscription record,
+// upgrading the legacy chunk0-1..chunk0-4 format in place: those records
+// were a bare watermark JSON object with no source_type, and every one of
+// them was an RSS feed (collectors didn't exist yet). Without this, old
+// records unmarshal "successfully" into a zeroed subscriptionState, which
+// breaks collectorFor forever and silently drops the dedup watermark.
+func decodeSubscriptionState(raw []byte) (subscriptionState, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return subscriptionState{}, err
+	}
+	if _, ok := probe["source_type"]; !ok {
+		var wm watermark
+		if err := json.Unmarshal(raw, &wm); err != nil {
+			return subscriptionState{}, err
+		}
+		return subscriptionState{SourceType: collectors.SourceRSS, Watermark: wm}, nil
+	}
+	var state subscriptionState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return subscriptionState{}, err
+	}
+	return state, nil
+}
+
+func mustMarshal(v any) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("error: marshaling %T: %v", v, err))
+	}
+	return b
+}